@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -22,9 +23,62 @@ type Client struct {
 	cpuStatsRWMutex sync.RWMutex
 	// Cache to calculate cpu usage
 	cpuStatsCache map[string]cpuEntry // containerID -> sizes
+
+	osTypeRWMutex sync.RWMutex
+	// Cache for the daemon's OS, resolved lazily via client.Info().OSType
+	osTypeKnown bool
+	osType      Platform
+
+	// statsCollector is non-nil when streaming stats mode is enabled; it
+	// owns the background per-container ContainerStats(Stream:true)
+	// goroutines that back GetContainerStats.
+	statsCollector       *StatsCollector
+	statsCollectorCancel context.CancelFunc
+
+	// perInterfaceNetStats gates populating ContainerStats.NetByInterface;
+	// off by default since most deployments only care about the aggregate.
+	perInterfaceNetStats bool
+
+	// statsBackend selects between the daemon API and reading cgroup/proc
+	// files directly; see EnableCgroupStatsBackend. The zero value behaves
+	// as StatsBackendDaemon.
+	statsBackend StatsBackend
+	cgroupRoot   string
+
+	cgroupVersionRWMutex sync.RWMutex
+	cgroupVersionCache   cgroupVersion
+
+	cgroupDriverRWMutex sync.RWMutex
+	// Cache for the daemon's configured cgroup driver, resolved lazily via
+	// client.Info().CgroupDriver
+	cgroupDriverKnown bool
+	cgroupDriver      string
+
+	cgroupBackendRWMutex sync.RWMutex
+	// cgroupBackendDisabled latches true the first time the cgroup backend
+	// fails under StatsBackendAuto, so later calls go straight to the
+	// daemon backend instead of repeating the failed read every scrape.
+	cgroupBackendDisabled bool
+
+	healthRWMutex sync.RWMutex
+	// Cache for GetContainerHealth, keyed by containerID.
+	healthCache    map[string]healthEntry
+	healthCacheTTL time.Duration
 }
 
-func NewDockerClient(host string, sizeCacheDuration time.Duration, diskUsageCacheDuration time.Duration) (*Client, error) {
+// EnablePerInterfaceNetStats makes GetContainerStats also populate
+// ContainerStats.NetByInterface with a per-network-interface breakdown, in
+// addition to the always-present aggregate Net total.
+func (c *Client) EnablePerInterfaceNetStats() {
+	c.perInterfaceNetStats = true
+}
+
+func NewDockerClient(
+	host string,
+	sizeCacheDuration time.Duration,
+	diskUsageCacheDuration time.Duration,
+	healthCacheDuration time.Duration,
+) (*Client, error) {
 	c, err := client.New(
 		client.WithHost(host),
 		client.WithUserAgent("docker-exporter"),
@@ -38,5 +92,32 @@ func NewDockerClient(host string, sizeCacheDuration time.Duration, diskUsageCach
 		sizeCache:      NewCacheFull("sizeCache", sizeCacheDuration, loadContainerSizeFunction(c), copyMap),
 		diskUsageCache: NewCache("diskUsageCache", diskUsageCacheDuration, loadDiskUsageFunction(c)),
 		cpuStatsCache:  make(map[string]cpuEntry),
+		healthCache:    make(map[string]healthEntry),
+		healthCacheTTL: healthCacheDuration,
 	}, nil
 }
+
+// EnableStreamingStats starts a background StatsCollector that keeps one
+// ContainerStats(Stream:true) goroutine per running container alive,
+// reducing GetContainerStats to an O(1) cache lookup instead of a per-call
+// daemon round trip. maxConcurrentStreams bounds how many of those goroutines
+// may be open at once, for the lifetime of each connection, not just while
+// it's being established: containers beyond the cap aren't streamed until a
+// slot frees up, and GetContainerStats falls back to the slower on-demand
+// backend for them in the meantime.
+// idleEvictAfter controls how long a stopped container's last sample is kept
+// around before it's evicted. Call Close to
+// stop the collector.
+func (c *Client) EnableStreamingStats(maxConcurrentStreams int, idleEvictAfter time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.statsCollectorCancel = cancel
+	c.statsCollector = NewStatsCollector(c, maxConcurrentStreams, idleEvictAfter)
+	go c.statsCollector.Run(ctx)
+}
+
+// Close stops the background streaming stats collector, if enabled.
+func (c *Client) Close() {
+	if c.statsCollectorCancel != nil {
+		c.statsCollectorCancel()
+	}
+}
@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/h3rmt/docker-exporter/internal/glob"
+)
+
+// ContainerHealth carries the liveness signals ContainerStats doesn't: the
+// healthcheck status and restart/exit history that dashboards and alerts
+// need but `docker stats` can't express.
+type ContainerHealth struct {
+	// Status is one of "healthy", "unhealthy", "starting", or "none" if the
+	// container has no healthcheck configured.
+	Status        string
+	FailingStreak int
+	LastExitCode  int
+	RestartCount  int
+	StartedAt     time.Time
+}
+
+type healthEntry struct {
+	health    ContainerHealth
+	expiresAt time.Time
+}
+
+// GetContainerHealth returns the container's healthcheck status and
+// restart/exit history, sourced from ContainerInspect and cached for
+// healthCacheDuration so frequent scrapes don't re-inspect on every call.
+func (c *Client) GetContainerHealth(ctx context.Context, containerID string) (ContainerHealth, error) {
+	c.healthRWMutex.RLock()
+	entry, ok := c.healthCache[containerID]
+	c.healthRWMutex.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.health, nil
+	}
+
+	health, err := c.loadContainerHealth(ctx, containerID)
+	if err != nil {
+		glob.SetError("GetContainerHealth", &err)
+		return ContainerHealth{}, err
+	}
+
+	c.healthRWMutex.Lock()
+	c.healthCache[containerID] = healthEntry{
+		health:    health,
+		expiresAt: time.Now().Add(c.healthCacheTTL),
+	}
+	c.healthRWMutex.Unlock()
+
+	glob.SetError("GetContainerHealth", nil)
+	return health, nil
+}
+
+func (c *Client) loadContainerHealth(ctx context.Context, containerID string) (ContainerHealth, error) {
+	inspect, err := c.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return ContainerHealth{}, err
+	}
+
+	health := ContainerHealth{
+		Status: "none",
+	}
+	if inspect.State != nil {
+		health.LastExitCode = inspect.State.ExitCode
+		if startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt); err == nil {
+			health.StartedAt = startedAt
+		}
+		if inspect.State.Health != nil {
+			health.Status = inspect.State.Health.Status
+			health.FailingStreak = inspect.State.Health.FailingStreak
+		}
+	}
+	health.RestartCount = inspect.RestartCount
+
+	return health, nil
+}
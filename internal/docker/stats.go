@@ -4,14 +4,36 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/h3rmt/docker-exporter/internal/glob"
 	"github.com/h3rmt/docker-exporter/internal/log"
 	"github.com/moby/moby/client"
 )
 
+// Platform identifies the OS of the Docker daemon a container is running
+// under, since the stats JSON shape (and the math needed to turn it into a
+// CPU percentage) differs between the two.
+type Platform int
+
+const (
+	PlatformLinux Platform = iota
+	PlatformWindows
+)
+
+func (p Platform) String() string {
+	switch p {
+	case PlatformWindows:
+		return "windows"
+	default:
+		return "linux"
+	}
+}
+
 type ContainerCpuStats struct {
-	// Raw CPU counters (ns).
+	// Raw CPU counters. On Linux these are nanoseconds; on Windows
+	// UsageNS/PreUsageNS are 100ns ticks as reported by the daemon.
 	UsageNS          uint64
 	UsageUserNS      uint64
 	UsageKernelNS    uint64
@@ -20,6 +42,20 @@ type ContainerCpuStats struct {
 	PreSystemUsageNS uint64
 
 	OnlineCpus uint32
+
+	// Per-core usage (ns), indexed by CPU number. Linux-only.
+	PercpuUsageNS []uint64
+
+	// CFS throttling counters (cumulative since container start). Linux-only.
+	Periods          uint64
+	ThrottledPeriods uint64
+	ThrottledTimeNS  uint64
+
+	// Windows-only: wall-clock sample timestamps (unix ns), used in place of
+	// SystemUsageNS/PreSystemUsageNS when computing CPU% on that platform.
+	ReadNS    int64
+	PreReadNS int64
+	NumProcs  uint32
 }
 
 type ContainerNetStats struct {
@@ -34,8 +70,16 @@ type ContainerNetStats struct {
 type ContainerStats struct {
 	PIds uint64
 
+	OS Platform
+
 	Cpu ContainerCpuStats
+	// Net is the summed total across all of the container's network
+	// interfaces.
 	Net ContainerNetStats
+	// NetByInterface holds the per-interface breakdown (keyed by interface
+	// name, e.g. "eth0"), populated only when the Client has per-interface
+	// net stats enabled. Nil otherwise.
+	NetByInterface map[string]ContainerNetStats
 
 	MemoryUsageKiB uint64
 	MemoryLimitKiB uint64
@@ -45,6 +89,12 @@ type ContainerStats struct {
 }
 
 type recStats struct {
+	// Windows-only: wall-clock sample timestamps.
+	Read    time.Time `json:"read"`
+	PreRead time.Time `json:"preread"`
+	// Windows-only: number of processes running in the container.
+	NumProcs uint64 `json:"num_procs"`
+
 	PidsStats struct {
 		Current uint64 `json:"current"`
 	} `json:"pids_stats"`
@@ -52,10 +102,16 @@ type recStats struct {
 		SystemCpuUsage uint64 `json:"system_cpu_usage"`
 		OnlineCpus     uint32 `json:"online_cpus"`
 		CpuUsage       struct {
-			UsageInKernelmode uint64 `json:"usage_in_kernelmode"`
-			UsageInUsermode   uint64 `json:"usage_in_usermode"`
-			TotalUsage        uint64 `json:"total_usage"`
+			UsageInKernelmode uint64   `json:"usage_in_kernelmode"`
+			UsageInUsermode   uint64   `json:"usage_in_usermode"`
+			TotalUsage        uint64   `json:"total_usage"`
+			PercpuUsage       []uint64 `json:"percpu_usage"`
 		} `json:"cpu_usage"`
+		ThrottlingData struct {
+			Periods          uint64 `json:"periods"`
+			ThrottledPeriods uint64 `json:"throttled_periods"`
+			ThrottledTime    uint64 `json:"throttled_time"`
+		} `json:"throttling_data"`
 	} `json:"cpu_stats"`
 	PreCpuStats struct {
 		SystemCpuUsage uint64 `json:"system_cpu_usage"`
@@ -80,6 +136,8 @@ type recStats struct {
 		Stats struct {
 			InactiveFile uint64 `json:"inactive_file"`
 		} `json:"stats"`
+		// Windows-only memory counter.
+		Privateworkingset uint64 `json:"privateworkingset"`
 	} `json:"memory_stats"`
 	Networks map[string]struct {
 		RxBytes   uint64 `json:"rx_bytes"`
@@ -89,14 +147,77 @@ type recStats struct {
 		TxErrors  uint64 `json:"tx_errors"`
 		TxDropped uint64 `json:"tx_dropped"`
 	} `json:"networks"`
+	// Windows-only block IO counters, reported outside blkio_stats.
+	StorageStats struct {
+		ReadSizeBytes  uint64 `json:"read_size_bytes"`
+		WriteSizeBytes uint64 `json:"write_size_bytes"`
+	} `json:"storage_stats"`
 }
 
 type cpuEntry struct {
 	UsageNS       uint64
 	SystemUsageNS uint64
+	// Windows-only: wall-clock sample timestamp (unix ns).
+	ReadNS int64
 }
 
+// platform returns the OS of the Docker daemon, resolved lazily from
+// client.Info().OSType on first use and cached for the lifetime of the
+// Client. Defaults to PlatformLinux if the daemon can't be reached.
+func (c *Client) platform(ctx context.Context) Platform {
+	c.osTypeRWMutex.RLock()
+	known := c.osTypeKnown
+	p := c.osType
+	c.osTypeRWMutex.RUnlock()
+	if known {
+		return p
+	}
+
+	p = PlatformLinux
+	if info, err := c.client.Info(ctx); err == nil && strings.EqualFold(info.OSType, "windows") {
+		p = PlatformWindows
+	}
+
+	c.osTypeRWMutex.Lock()
+	c.osType = p
+	c.osTypeKnown = true
+	c.osTypeRWMutex.Unlock()
+	return p
+}
+
+// GetContainerStats returns the last known stats for containerID. If a
+// StatsCollector is running and already has a sample for this container, the
+// lookup is O(1); otherwise it reads a sample on demand, from cgroup files
+// when the cgroup backend is enabled (and, under StatsBackendAuto, has not
+// failed yet) or else through a ContainerStats call against the daemon.
 func (c *Client) GetContainerStats(ctx context.Context, containerID string, cpu bool) (ContainerStats, error) {
+	if c.statsCollector != nil {
+		if stats, ok := c.statsCollector.get(containerID, cpu); ok {
+			glob.SetError("GetContainerStats", nil)
+			return stats, nil
+		}
+	}
+
+	if c.useCgroupBackend() {
+		stats, err := c.getContainerStatsCgroup(ctx, containerID, cpu)
+		if err == nil {
+			glob.SetError("GetContainerStats", nil)
+			return stats, nil
+		}
+		if c.statsBackend != StatsBackendAuto {
+			glob.SetError("GetContainerStats", &err)
+			return ContainerStats{}, err
+		}
+		log.GetLogger().WarnContext(
+			ctx,
+			"Cgroup stats backend failed, falling back to the Docker daemon backend",
+			"error", err,
+		)
+		c.cgroupBackendRWMutex.Lock()
+		c.cgroupBackendDisabled = true
+		c.cgroupBackendRWMutex.Unlock()
+	}
+
 	stats, err := c.getContainerStats(ctx, containerID, cpu)
 	if err != nil {
 		glob.SetError("GetContainerStats", &err)
@@ -126,6 +247,15 @@ func (c *Client) getContainerStats(ctx context.Context, containerID string, cpu
 		return ContainerStats{}, err
 	}
 
+	return c.statFromRec(ctx, containerID, rec, cpu), nil
+}
+
+// statFromRec turns a decoded stats sample into a ContainerStats, updating
+// the per-container CPU delta cache along the way. Shared by the one-shot
+// and streaming (StatsCollector) decode paths.
+func (c *Client) statFromRec(ctx context.Context, containerID string, rec recStats, cpu bool) ContainerStats {
+	platform := c.platform(ctx)
+
 	var data ContainerCpuStats
 	if cpu {
 		c.cpuStatsRWMutex.RLock()
@@ -140,70 +270,97 @@ func (c *Client) getContainerStats(ctx context.Context, containerID string, cpu
 			SystemUsageNS:    rec.CpuStats.SystemCpuUsage,
 			PreSystemUsageNS: prev.SystemUsageNS,
 			OnlineCpus:       rec.CpuStats.OnlineCpus,
+			PercpuUsageNS:    rec.CpuStats.CpuUsage.PercpuUsage,
+			Periods:          rec.CpuStats.ThrottlingData.Periods,
+			ThrottledPeriods: rec.CpuStats.ThrottlingData.ThrottledPeriods,
+			ThrottledTimeNS:  rec.CpuStats.ThrottlingData.ThrottledTime,
+			ReadNS:           rec.Read.UnixNano(),
+			PreReadNS:        prev.ReadNS,
+			NumProcs:         uint32(rec.NumProcs),
 		}
 
 		c.cpuStatsRWMutex.Lock()
 		c.cpuStatsCache[containerID] = cpuEntry{
 			UsageNS:       rec.CpuStats.CpuUsage.TotalUsage,
 			SystemUsageNS: rec.CpuStats.SystemCpuUsage,
+			ReadNS:        rec.Read.UnixNano(),
 		}
 		c.cpuStatsRWMutex.Unlock()
 	}
 
-	// Network totals
-	var netSendBytes uint64
-	var netSendErrors uint64
-	var netSendDropped uint64
-	var netRecBytes uint64
-	var netRecErrors uint64
-	var netRecDropped uint64
-	for _, net := range rec.Networks {
-		netSendBytes += net.TxBytes
-		netSendErrors += net.TxErrors
-		netSendDropped += net.TxDropped
-		netRecBytes += net.RxBytes
-		netRecErrors += net.RxErrors
-		netRecDropped += net.RxDropped
+	// Per-interface counters plus a summed total, which remains the default
+	// shape consumers see unless per-interface net stats are enabled.
+	var netByInterface map[string]ContainerNetStats
+	if c.perInterfaceNetStats {
+		netByInterface = make(map[string]ContainerNetStats, len(rec.Networks))
 	}
-	net := ContainerNetStats{
-		SendBytes:   netSendBytes,
-		SendDropped: netSendDropped,
-		SendErrors:  netSendErrors,
-		RecvBytes:   netRecBytes,
-		RecvDropped: netRecDropped,
-		RecvErrors:  netRecErrors,
+	var netTotal ContainerNetStats
+	for iface, net := range rec.Networks {
+		entry := ContainerNetStats{
+			SendBytes:   net.TxBytes,
+			SendDropped: net.TxDropped,
+			SendErrors:  net.TxErrors,
+			RecvBytes:   net.RxBytes,
+			RecvDropped: net.RxDropped,
+			RecvErrors:  net.RxErrors,
+		}
+		if netByInterface != nil {
+			netByInterface[iface] = entry
+		}
+		netTotal.SendBytes += entry.SendBytes
+		netTotal.SendDropped += entry.SendDropped
+		netTotal.SendErrors += entry.SendErrors
+		netTotal.RecvBytes += entry.RecvBytes
+		netTotal.RecvDropped += entry.RecvDropped
+		netTotal.RecvErrors += entry.RecvErrors
 	}
 
-	// Block IO totals
+	// Block IO and memory totals, computed differently per platform: Windows
+	// reports these under storage_stats/privateworkingset instead of
+	// blkio_stats/usage.
+	var memoryUsageKiB uint64
+	var memoryLimitKiB uint64
 	var blockInputBytes uint64
 	var blockOutputBytes uint64
-	for _, ioB := range rec.BlkioStats.IoServiceBytesRecursive {
-		switch ioB.Op {
-		case "read":
-			blockInputBytes += uint64(ioB.Value)
-		case "write":
-			blockOutputBytes += uint64(ioB.Value)
-		default:
-			log.GetLogger().WarnContext(
-				ctx,
-				"Unknown blkio operation",
-				"operation",
-				ioB.Op,
-				"container_id",
-				containerID,
-			)
+
+	switch platform {
+	case PlatformWindows:
+		memoryUsageKiB = rec.MemoryStats.Privateworkingset / 1024
+		blockInputBytes = rec.StorageStats.ReadSizeBytes
+		blockOutputBytes = rec.StorageStats.WriteSizeBytes
+	default:
+		memoryUsageKiB = (rec.MemoryStats.Usage - rec.MemoryStats.Stats.InactiveFile) / 1024
+		memoryLimitKiB = rec.MemoryStats.Limit / 1024
+		for _, ioB := range rec.BlkioStats.IoServiceBytesRecursive {
+			switch ioB.Op {
+			case "read":
+				blockInputBytes += uint64(ioB.Value)
+			case "write":
+				blockOutputBytes += uint64(ioB.Value)
+			default:
+				log.GetLogger().WarnContext(
+					ctx,
+					"Unknown blkio operation",
+					"operation",
+					ioB.Op,
+					"container_id",
+					containerID,
+				)
+			}
 		}
 	}
 
 	stat := ContainerStats{
 		PIds:             rec.PidsStats.Current,
+		OS:               platform,
 		Cpu:              data,
-		MemoryUsageKiB:   (rec.MemoryStats.Usage - rec.MemoryStats.Stats.InactiveFile) / 1024,
-		MemoryLimitKiB:   rec.MemoryStats.Limit / 1024,
-		Net:              net,
+		MemoryUsageKiB:   memoryUsageKiB,
+		MemoryLimitKiB:   memoryLimitKiB,
+		Net:              netTotal,
+		NetByInterface:   netByInterface,
 		BlockInputBytes:  blockInputBytes,
 		BlockOutputBytes: blockOutputBytes,
 	}
 
-	return stat, nil
+	return stat
 }
@@ -0,0 +1,589 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/h3rmt/docker-exporter/internal/log"
+)
+
+// StatsBackend selects how Client.GetContainerStats retrieves a sample.
+type StatsBackend string
+
+const (
+	// StatsBackendDaemon calls ContainerStats through the Docker API. This
+	// is the default and works wherever the daemon is reachable.
+	StatsBackendDaemon StatsBackend = "daemon"
+	// StatsBackendCgroup reads cgroup v1/v2 files and /proc/<pid>/net/dev
+	// directly, bypassing dockerd entirely. Requires the exporter to have
+	// host cgroup and proc access (e.g. a hostPID container with the host's
+	// /sys/fs/cgroup bind-mounted in).
+	StatsBackendCgroup StatsBackend = "cgroup"
+	// StatsBackendAuto uses the cgroup backend, falling back permanently to
+	// the daemon backend the first time a cgroup read fails.
+	StatsBackendAuto StatsBackend = "auto"
+)
+
+type cgroupVersion int
+
+const (
+	cgroupVersionUnknown cgroupVersion = iota
+	cgroupVersionV1
+	cgroupVersionV2
+)
+
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+// EnableCgroupStatsBackend switches GetContainerStats to backend instead of
+// the default daemon API. root overrides the cgroup mount point
+// (defaultCgroupRoot if empty); it exists mainly so the exporter can point
+// at a bind-mounted host /sys/fs/cgroup when it is itself containerized.
+func (c *Client) EnableCgroupStatsBackend(backend StatsBackend, root string) {
+	c.statsBackend = backend
+	c.cgroupRoot = root
+}
+
+// useCgroupBackend reports whether the cgroup backend should be tried for
+// this call. It returns false permanently for StatsBackendAuto once a prior
+// cgroup read has failed, so every subsequent scrape goes straight to the
+// daemon backend instead of re-discovering the failure each time.
+func (c *Client) useCgroupBackend() bool {
+	switch c.statsBackend {
+	case StatsBackendCgroup:
+		return true
+	case StatsBackendAuto:
+		c.cgroupBackendRWMutex.RLock()
+		disabled := c.cgroupBackendDisabled
+		c.cgroupBackendRWMutex.RUnlock()
+		return !disabled
+	default:
+		return false
+	}
+}
+
+func (c *Client) cgroupRootPath() string {
+	if c.cgroupRoot != "" {
+		return c.cgroupRoot
+	}
+	return defaultCgroupRoot
+}
+
+// cgroupVersionOf detects cgroup v1 vs v2, cached for the lifetime of the
+// Client: v2 hosts expose a unified cgroup.controllers file at the mount
+// root, v1 hosts don't.
+func (c *Client) cgroupVersionOf() cgroupVersion {
+	c.cgroupVersionRWMutex.RLock()
+	v := c.cgroupVersionCache
+	c.cgroupVersionRWMutex.RUnlock()
+	if v != cgroupVersionUnknown {
+		return v
+	}
+
+	v = cgroupVersionV1
+	if _, err := os.Stat(filepath.Join(c.cgroupRootPath(), "cgroup.controllers")); err == nil {
+		v = cgroupVersionV2
+	}
+
+	c.cgroupVersionRWMutex.Lock()
+	c.cgroupVersionCache = v
+	c.cgroupVersionRWMutex.Unlock()
+	return v
+}
+
+// cgroupV1Path returns the per-subsystem cgroup directory for a container,
+// given its driver-resolved relative path (see containerCgroupRelPath).
+func (c *Client) cgroupV1Path(subsystem, relPath string) string {
+	return filepath.Join(c.cgroupRootPath(), subsystem, relPath)
+}
+
+// cgroupV2Path returns the unified cgroup directory for a container, given
+// its driver-resolved relative path (see containerCgroupRelPath).
+func (c *Client) cgroupV2Path(relPath string) string {
+	return filepath.Join(c.cgroupRootPath(), relPath)
+}
+
+// cgroupDriverOf detects the daemon's configured cgroup driver, cached for
+// the lifetime of the Client the same way platform() caches OSType.
+func (c *Client) cgroupDriverOf(ctx context.Context) string {
+	c.cgroupDriverRWMutex.RLock()
+	known := c.cgroupDriverKnown
+	d := c.cgroupDriver
+	c.cgroupDriverRWMutex.RUnlock()
+	if known {
+		return d
+	}
+
+	d = "cgroupfs"
+	if info, err := c.client.Info(ctx); err == nil && info.CgroupDriver != "" {
+		d = info.CgroupDriver
+	}
+
+	c.cgroupDriverRWMutex.Lock()
+	c.cgroupDriver = d
+	c.cgroupDriverKnown = true
+	c.cgroupDriverRWMutex.Unlock()
+	return d
+}
+
+// containerCgroupRelPath returns the container's cgroup path relative to a
+// v1 subsystem directory or the v2 mount root, honoring whichever cgroup
+// driver the daemon is configured with:
+//   - cgroupfs (cgroupDriverOf == "cgroupfs"): "<parent|docker>/<id>"
+//   - systemd: "<parent|system.slice>/docker-<id>.scope"
+//
+// cgroupParent comes from the container's HostConfig.CgroupParent and
+// overrides the driver's default parent when the container set one.
+func (c *Client) containerCgroupRelPath(ctx context.Context, containerID, cgroupParent string) string {
+	if c.cgroupDriverOf(ctx) == "systemd" {
+		parent := cgroupParent
+		if parent == "" {
+			parent = "system.slice"
+		}
+		return filepath.Join(parent, "docker-"+containerID+".scope")
+	}
+
+	parent := cgroupParent
+	if parent == "" {
+		parent = "docker"
+	}
+	return filepath.Join(parent, containerID)
+}
+
+func (c *Client) getContainerStatsCgroup(ctx context.Context, containerID string, cpu bool) (ContainerStats, error) {
+	inspect, err := c.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	if inspect.State == nil {
+		return ContainerStats{}, fmt.Errorf("container %s has no state", containerID)
+	}
+
+	var cgroupParent string
+	if inspect.HostConfig != nil {
+		cgroupParent = inspect.HostConfig.CgroupParent
+	}
+	relPath := c.containerCgroupRelPath(ctx, containerID, cgroupParent)
+
+	ver := c.cgroupVersionOf()
+
+	pids, err := readCgroupPids(c, relPath, ver)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	var data ContainerCpuStats
+	if cpu {
+		data, err = c.readCgroupCpuStats(containerID, relPath, ver)
+		if err != nil {
+			return ContainerStats{}, err
+		}
+	}
+
+	memUsageKiB, memLimitKiB, err := readCgroupMemoryStats(c, relPath, ver)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	blockInputBytes, blockOutputBytes, err := readCgroupIOStats(c, relPath, ver)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	netTotal, netByInterface, err := readProcNetDev(inspect.State.Pid, c.perInterfaceNetStats)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	return ContainerStats{
+		PIds:             pids,
+		OS:               PlatformLinux,
+		Cpu:              data,
+		Net:              netTotal,
+		NetByInterface:   netByInterface,
+		MemoryUsageKiB:   memUsageKiB,
+		MemoryLimitKiB:   memLimitKiB,
+		BlockInputBytes:  blockInputBytes,
+		BlockOutputBytes: blockOutputBytes,
+	}, nil
+}
+
+func readCgroupPids(c *Client, relPath string, ver cgroupVersion) (uint64, error) {
+	path := c.cgroupV2Path(relPath)
+	if ver == cgroupVersionV1 {
+		path = c.cgroupV1Path("pids", relPath)
+	}
+	return readUintFile(filepath.Join(path, "pids.current"))
+}
+
+// readCgroupCpuStats reads cumulative CPU counters and turns them into a
+// ContainerCpuStats delta against the last sample, reusing the same
+// cpuStatsCache the daemon backend populates so the two backends are
+// interchangeable mid-flight. SystemUsageNS and OnlineCpus are populated
+// from /proc/stat and the cpuset controller respectively, so the same
+// UsageNS-delta/SystemUsageNS-delta*OnlineCpus formula the daemon backend
+// feeds works unchanged regardless of which backend produced the sample.
+func (c *Client) readCgroupCpuStats(containerID, relPath string, ver cgroupVersion) (ContainerCpuStats, error) {
+	var usageNS, userNS, kernelNS, periods, throttledPeriods, throttledTimeNS uint64
+	var err error
+
+	if ver == cgroupVersionV2 {
+		path := filepath.Join(c.cgroupV2Path(relPath), "cpu.stat")
+		fields, ferr := readKeyedFile(path)
+		if ferr != nil {
+			return ContainerCpuStats{}, ferr
+		}
+		usageNS = fields["usage_usec"] * 1000
+		userNS = fields["user_usec"] * 1000
+		kernelNS = fields["system_usec"] * 1000
+		periods = fields["nr_periods"]
+		throttledPeriods = fields["nr_throttled"]
+		throttledTimeNS = fields["throttled_usec"] * 1000
+	} else {
+		usageNS, err = readUintFile(filepath.Join(c.cgroupV1Path("cpuacct", relPath), "cpuacct.usage"))
+		if err != nil {
+			return ContainerCpuStats{}, err
+		}
+		userNS, err = readUintFile(filepath.Join(c.cgroupV1Path("cpuacct", relPath), "cpuacct.usage_user"))
+		if err != nil {
+			return ContainerCpuStats{}, err
+		}
+		kernelNS, err = readUintFile(filepath.Join(c.cgroupV1Path("cpuacct", relPath), "cpuacct.usage_sys"))
+		if err != nil {
+			return ContainerCpuStats{}, err
+		}
+		fields, ferr := readKeyedFile(filepath.Join(c.cgroupV1Path("cpu", relPath), "cpu.stat"))
+		if ferr != nil {
+			return ContainerCpuStats{}, ferr
+		}
+		periods = fields["nr_periods"]
+		throttledPeriods = fields["nr_throttled"]
+		throttledTimeNS = fields["throttled_time"]
+	}
+
+	systemUsageNS, err := readSystemCpuUsageNS()
+	if err != nil {
+		return ContainerCpuStats{}, err
+	}
+	onlineCpus := c.readOnlineCpus(relPath, ver)
+
+	c.cpuStatsRWMutex.RLock()
+	prev := c.cpuStatsCache[containerID]
+	c.cpuStatsRWMutex.RUnlock()
+
+	c.cpuStatsRWMutex.Lock()
+	c.cpuStatsCache[containerID] = cpuEntry{UsageNS: usageNS, SystemUsageNS: systemUsageNS}
+	c.cpuStatsRWMutex.Unlock()
+
+	return ContainerCpuStats{
+		UsageNS:          usageNS,
+		UsageUserNS:      userNS,
+		UsageKernelNS:    kernelNS,
+		PreUsageNS:       prev.UsageNS,
+		SystemUsageNS:    systemUsageNS,
+		PreSystemUsageNS: prev.SystemUsageNS,
+		OnlineCpus:       onlineCpus,
+		Periods:          periods,
+		ThrottledPeriods: throttledPeriods,
+		ThrottledTimeNS:  throttledTimeNS,
+	}, nil
+}
+
+// systemCpuStatFields is the number of /proc/stat "cpu" fields that count
+// toward system CPU time: user, nice, system, idle, iowait, irq, softirq,
+// steal. The fields after this (guest, guest_nice) are excluded because
+// they're time already counted inside user/nice, and moby's own
+// SystemCpuUsage (system.ReadSystemCPUUsage) sums only through steal too.
+const systemCpuStatFields = 8
+
+// readSystemCpuUsageNS returns the host's cumulative CPU time since boot,
+// summed across the user..steal fields of the "cpu" line in /proc/stat and
+// converted from clock ticks to nanoseconds, mirroring what the daemon
+// reports as CpuStats.SystemCpuUsage so deltas from the two backends are
+// comparable.
+func readSystemCpuUsageNS() (uint64, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "cpu" {
+			continue
+		}
+		end := 1 + systemCpuStatFields
+		if len(fields) < end {
+			end = len(fields)
+		}
+		var ticks uint64
+		for _, field := range fields[1:end] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				continue
+			}
+			ticks += v
+		}
+		const nsPerClockTick = uint64(time.Second) / 100 // USER_HZ is 100 on Linux
+		return ticks * nsPerClockTick, nil
+	}
+	return 0, fmt.Errorf("parsing /proc/stat: no cpu line found")
+}
+
+// readOnlineCpus returns the number of CPUs available to the container's
+// cgroup, read from the cpuset controller's effective CPU list. Falls back
+// to the host's total CPU count when the cgroup has no cpuset limits
+// configured, which is the common case.
+func (c *Client) readOnlineCpus(relPath string, ver cgroupVersion) uint32 {
+	path := filepath.Join(c.cgroupV2Path(relPath), "cpuset.cpus.effective")
+	if ver == cgroupVersionV1 {
+		path = filepath.Join(c.cgroupV1Path("cpuset", relPath), "cpuset.effective_cpus")
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return uint32(runtime.NumCPU())
+	}
+	if n := parseCpusetCount(strings.TrimSpace(string(b))); n > 0 {
+		return uint32(n)
+	}
+	return uint32(runtime.NumCPU())
+}
+
+// parseCpusetCount counts the CPUs named by a cpuset list like "0-2,4,6-7".
+func parseCpusetCount(s string) int {
+	count := 0
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			continue
+		}
+		lo, hi, ok := strings.Cut(part, "-")
+		if !ok {
+			count++
+			continue
+		}
+		loN, err1 := strconv.Atoi(lo)
+		hiN, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || hiN < loN {
+			continue
+		}
+		count += hiN - loN + 1
+	}
+	return count
+}
+
+func readCgroupMemoryStats(c *Client, relPath string, ver cgroupVersion) (usageKiB, limitKiB uint64, err error) {
+	if ver == cgroupVersionV2 {
+		path := c.cgroupV2Path(relPath)
+		usage, err := readUintFile(filepath.Join(path, "memory.current"))
+		if err != nil {
+			return 0, 0, err
+		}
+		stat, err := readKeyedFile(filepath.Join(path, "memory.stat"))
+		if err != nil {
+			return 0, 0, err
+		}
+		limit, err := readMemoryMaxFile(filepath.Join(path, "memory.max"))
+		if err != nil {
+			return 0, 0, err
+		}
+		return (usage - stat["inactive_file"]) / 1024, limit / 1024, nil
+	}
+
+	path := c.cgroupV1Path("memory", relPath)
+	usage, err := readUintFile(filepath.Join(path, "memory.usage_in_bytes"))
+	if err != nil {
+		return 0, 0, err
+	}
+	stat, err := readKeyedFile(filepath.Join(path, "memory.stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	limit, err := readUintFile(filepath.Join(path, "memory.limit_in_bytes"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return (usage - stat["total_inactive_file"]) / 1024, limit / 1024, nil
+}
+
+// readMemoryMaxFile reads a v2 memory.max/memory.high style file, treating
+// the literal "max" (cgroup v2's spelling for "no limit") as 0 instead of
+// failing to parse it as a number. Every container started without an
+// explicit memory limit — the default — reports "max" here.
+func readMemoryMaxFile(path string) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "max" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return v, nil
+}
+
+func readCgroupIOStats(c *Client, relPath string, ver cgroupVersion) (readBytes, writeBytes uint64, err error) {
+	if ver == cgroupVersionV2 {
+		f, err := os.Open(filepath.Join(c.cgroupV2Path(relPath), "io.stat"))
+		if err != nil {
+			return 0, 0, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 1 {
+				continue
+			}
+			for _, field := range fields[1:] {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				val, _ := strconv.ParseUint(kv[1], 10, 64)
+				switch kv[0] {
+				case "rbytes":
+					readBytes += val
+				case "wbytes":
+					writeBytes += val
+				}
+			}
+		}
+		return readBytes, writeBytes, scanner.Err()
+	}
+
+	f, err := os.Open(filepath.Join(c.cgroupV1Path("blkio", relPath), "blkio.throttle.io_service_bytes"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		val, _ := strconv.ParseUint(fields[2], 10, 64)
+		switch fields[1] {
+		case "Read":
+			readBytes += val
+		case "Write":
+			writeBytes += val
+		}
+	}
+	return readBytes, writeBytes, scanner.Err()
+}
+
+// readProcNetDev parses /proc/<pid>/net/dev, which lives in the container's
+// own network namespace, giving the same per-interface shape the daemon's
+// "networks" stats field reports.
+func readProcNetDev(pid int, perInterface bool) (ContainerNetStats, map[string]ContainerNetStats, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if err != nil {
+		return ContainerNetStats{}, nil, err
+	}
+	defer f.Close()
+
+	var byInterface map[string]ContainerNetStats
+	if perInterface {
+		byInterface = make(map[string]ContainerNetStats)
+	}
+	var total ContainerNetStats
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		if lineNum <= 2 {
+			// Header lines.
+			continue
+		}
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		iface := strings.TrimSpace(parts[0])
+		if iface == "lo" {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) < 16 {
+			continue
+		}
+		entry := ContainerNetStats{
+			RecvBytes:   mustParseUint(fields[0]),
+			RecvErrors:  mustParseUint(fields[2]),
+			RecvDropped: mustParseUint(fields[3]),
+			SendBytes:   mustParseUint(fields[8]),
+			SendErrors:  mustParseUint(fields[10]),
+			SendDropped: mustParseUint(fields[11]),
+		}
+		if byInterface != nil {
+			byInterface[iface] = entry
+		}
+		total.RecvBytes += entry.RecvBytes
+		total.RecvErrors += entry.RecvErrors
+		total.RecvDropped += entry.RecvDropped
+		total.SendBytes += entry.SendBytes
+		total.SendErrors += entry.SendErrors
+		total.SendDropped += entry.SendDropped
+	}
+	return total, byInterface, scanner.Err()
+}
+
+func mustParseUint(s string) uint64 {
+	v, _ := strconv.ParseUint(s, 10, 64)
+	return v
+}
+
+func readUintFile(path string) (uint64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// readKeyedFile parses cgroup files laid out as "key value" per line (e.g.
+// cpu.stat, memory.stat).
+func readKeyedFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fields := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 2 {
+			continue
+		}
+		val, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			log.GetLogger().Warn("Failed to parse cgroup stat line", "file", path, "line", scanner.Text())
+			continue
+		}
+		fields[parts[0]] = val
+	}
+	return fields, scanner.Err()
+}
@@ -0,0 +1,257 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/h3rmt/docker-exporter/internal/log"
+	"github.com/moby/moby/api/types/events"
+	"github.com/moby/moby/client"
+)
+
+// StatsCollector runs one background goroutine per running container,
+// each holding open a ContainerStats(Stream:true) connection and decoding
+// samples as the daemon pushes them. This mirrors moby's own internal
+// daemon/stats_collector.go, avoiding the one-shot cgroup read + JSON encode
+// that a Stream:false call triggers on every Prometheus scrape.
+//
+// Containers are subscribed on a "start" event and unsubscribed on "die";
+// their last known sample is kept around for idleEvictAfter so a scrape that
+// lands just after a container stops still sees a final value.
+type StatsCollector struct {
+	client *Client
+
+	maxConcurrency int
+	idleEvictAfter time.Duration
+	sem            chan struct{}
+
+	mu        sync.RWMutex
+	stats     map[string]ContainerStats
+	lastSeen  map[string]time.Time
+	cancelFns map[string]context.CancelFunc
+
+	wg sync.WaitGroup
+}
+
+// NewStatsCollector builds a StatsCollector bound to c. maxConcurrency <= 0
+// is treated as 1.
+func NewStatsCollector(c *Client, maxConcurrency int, idleEvictAfter time.Duration) *StatsCollector {
+	if maxConcurrency <= 0 {
+		maxConcurrency = 1
+	}
+	return &StatsCollector{
+		client:         c,
+		maxConcurrency: maxConcurrency,
+		idleEvictAfter: idleEvictAfter,
+		sem:            make(chan struct{}, maxConcurrency),
+		stats:          make(map[string]ContainerStats),
+		lastSeen:       make(map[string]time.Time),
+		cancelFns:      make(map[string]context.CancelFunc),
+	}
+}
+
+// Run subscribes to every currently-running container, then follows the
+// daemon's event stream to pick up start/die events as they happen. It
+// blocks until ctx is cancelled or the event stream fails, so callers run it
+// in its own goroutine.
+func (sc *StatsCollector) Run(ctx context.Context) {
+	go sc.evictIdleLoop(ctx)
+
+	containers, err := sc.client.client.ContainerList(ctx, client.ContainerListOptions{})
+	if err != nil {
+		log.GetLogger().ErrorContext(ctx, "Failed to list running containers for stats collector", "error", err)
+	} else {
+		for _, ctr := range containers {
+			sc.subscribe(ctx, ctr.ID)
+		}
+	}
+
+	msgs, errs := sc.client.client.Events(ctx, client.EventsListOptions{})
+	for {
+		select {
+		case <-ctx.Done():
+			sc.cancelAll()
+			sc.wg.Wait()
+			return
+		case err := <-errs:
+			if err != nil && ctx.Err() == nil {
+				log.GetLogger().ErrorContext(ctx, "Docker event stream error, stats collector stopping", "error", err)
+			}
+			sc.cancelAll()
+			sc.wg.Wait()
+			return
+		case msg := <-msgs:
+			if msg.Type != events.ContainerEventType {
+				continue
+			}
+			switch msg.Action {
+			case events.ActionStart:
+				sc.subscribe(ctx, msg.Actor.ID)
+			case events.ActionDie:
+				sc.unsubscribe(msg.Actor.ID)
+			}
+		}
+	}
+}
+
+// get returns the last decoded sample for containerID, if one is available.
+// The background stream always decodes CPU counters (it needs them anyway
+// to track deltas), but if the caller passed cpu=false the returned sample's
+// Cpu field is zeroed so streamed and on-demand samples stay consistent:
+// GetContainerStats only ever returns populated CPU fields when asked for.
+func (sc *StatsCollector) get(containerID string, cpu bool) (ContainerStats, bool) {
+	sc.mu.RLock()
+	stats, ok := sc.stats[containerID]
+	sc.mu.RUnlock()
+	if ok && !cpu {
+		stats.Cpu = ContainerCpuStats{}
+	}
+	return stats, ok
+}
+
+func (sc *StatsCollector) subscribe(ctx context.Context, containerID string) {
+	sc.mu.Lock()
+	if _, ok := sc.cancelFns[containerID]; ok {
+		sc.mu.Unlock()
+		return
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	sc.cancelFns[containerID] = cancel
+	sc.mu.Unlock()
+
+	sc.wg.Add(1)
+	go sc.stream(streamCtx, containerID)
+}
+
+// unsubscribe stops the streaming goroutine for containerID but leaves its
+// last sample in place for evictIdleLoop to age out.
+func (sc *StatsCollector) unsubscribe(containerID string) {
+	sc.mu.Lock()
+	cancel, ok := sc.cancelFns[containerID]
+	delete(sc.cancelFns, containerID)
+	sc.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// cancelAll cancels every still-subscribed per-container stream. Used before
+// wg.Wait() on shutdown: stream goroutines parked waiting for a sem slot (see
+// stream below) only ever return via ctx cancellation, and on the Events
+// error path the parent ctx is still live, so without this wg.Wait() would
+// block forever.
+func (sc *StatsCollector) cancelAll() {
+	sc.mu.Lock()
+	cancels := make([]context.CancelFunc, 0, len(sc.cancelFns))
+	for containerID, cancel := range sc.cancelFns {
+		cancels = append(cancels, cancel)
+		delete(sc.cancelFns, containerID)
+	}
+	sc.mu.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+func (sc *StatsCollector) stream(ctx context.Context, containerID string) {
+	defer sc.wg.Done()
+	defer sc.endStream(ctx, containerID)
+
+	// maxConcurrency caps how many Stream:true connections may be open at
+	// once, not how fast they're opened: the slot is held for the stream's
+	// entire lifetime. A container beyond the cap parks here until an older
+	// stream closes (or this one is unsubscribed/cancelled) and is served by
+	// the on-demand daemon/cgroup backend in the meantime.
+	select {
+	case sc.sem <- struct{}{}:
+		defer func() { <-sc.sem }()
+	case <-ctx.Done():
+		return
+	}
+
+	resp, err := sc.client.client.ContainerStats(ctx, containerID, client.ContainerStatsOptions{Stream: true})
+	if err != nil {
+		log.GetLogger().ErrorContext(ctx, "Failed to open streaming container stats", "error", err, "container_id", containerID)
+		return
+	}
+	defer func(body io.ReadCloser) {
+		if err := body.Close(); err != nil {
+			log.GetLogger().ErrorContext(ctx, "Failed to close streaming container stats reader", "error", err)
+		}
+	}(resp.Body)
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var rec recStats
+		if err := dec.Decode(&rec); err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				log.GetLogger().ErrorContext(ctx, "Failed to decode streamed container stats", "error", err, "container_id", containerID)
+			}
+			return
+		}
+
+		stat := sc.client.statFromRec(ctx, containerID, rec, true)
+
+		sc.mu.Lock()
+		sc.stats[containerID] = stat
+		sc.lastSeen[containerID] = time.Now()
+		sc.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// endStream runs when a stream goroutine exits for any reason. If ctx is
+// still live, the stream ended on its own (a transient decode/connection
+// error) rather than via unsubscribe (die event) or Run shutting down, both
+// of which already own cleanup. Left alone, subscribe's dedup on cancelFns
+// would wedge the container on its last cached sample forever, so clear the
+// dead entry and resubscribe if the container is still running.
+func (sc *StatsCollector) endStream(ctx context.Context, containerID string) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	sc.mu.Lock()
+	delete(sc.cancelFns, containerID)
+	sc.mu.Unlock()
+
+	inspect, err := sc.client.client.ContainerInspect(ctx, containerID)
+	if err != nil || inspect.State == nil || !inspect.State.Running {
+		return
+	}
+	sc.subscribe(ctx, containerID)
+}
+
+// evictIdleLoop periodically drops samples that haven't been refreshed in
+// idleEvictAfter, i.e. containers that have been stopped for a while.
+func (sc *StatsCollector) evictIdleLoop(ctx context.Context) {
+	if sc.idleEvictAfter <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(sc.idleEvictAfter)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-sc.idleEvictAfter)
+			sc.mu.Lock()
+			for containerID, seen := range sc.lastSeen {
+				if seen.Before(cutoff) {
+					delete(sc.stats, containerID)
+					delete(sc.lastSeen, containerID)
+				}
+			}
+			sc.mu.Unlock()
+		}
+	}
+}